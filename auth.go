@@ -0,0 +1,191 @@
+// auth.go
+// Pluggable request authentication for /api/v1/getparams.execute: a static bearer token
+// (the original behavior), Kubernetes TokenReview, and mTLS client-certificate allowlisting.
+// Verifiers are chained so an operator can enable more than one scheme at once.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Verifier authenticates an incoming request. A non-nil error means the verifier itself
+// failed (e.g. couldn't reach the API server) and should be logged; it is not treated as an
+// authorization decision, so the chain keeps trying the remaining verifiers.
+type Verifier interface {
+	Name() string
+	Verify(r *http.Request) (bool, error)
+}
+
+// VerifierChain authorizes a request if any configured Verifier accepts it.
+type VerifierChain []Verifier
+
+// Verify runs each verifier in order and accepts the request as soon as one succeeds.
+func (c VerifierChain) Verify(r *http.Request) bool {
+	for _, v := range c {
+		ok, err := v.Verify(r)
+		if err != nil {
+			logger.Warn("auth verifier failed", "verifier", v.Name(), "error", err)
+			continue
+		}
+		if ok {
+			return true
+		}
+		authFailuresTotal.WithLabelValues(v.Name()).Inc()
+	}
+	return false
+}
+
+// StaticTokenVerifier accepts requests whose Authorization header is "Bearer <token>" for a
+// single, fixed token. This is the plugin's original (and still default) auth mode.
+type StaticTokenVerifier struct {
+	Token string
+}
+
+func (v *StaticTokenVerifier) Name() string { return "static-token" }
+
+func (v *StaticTokenVerifier) Verify(r *http.Request) (bool, error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return false, nil
+	}
+	return strings.TrimPrefix(authHeader, "Bearer ") == v.Token, nil
+}
+
+// TokenReviewVerifier delegates authentication to the Kubernetes API server via the
+// authentication.k8s.io/v1 TokenReview API, the same pattern kube components use to accept
+// projected ServiceAccount tokens (e.g. Argo's own SA token) without knowing about them
+// ahead of time.
+type TokenReviewVerifier struct {
+	Client    kubernetes.Interface
+	Audiences []string
+}
+
+func (v *TokenReviewVerifier) Name() string { return "tokenreview" }
+
+func (v *TokenReviewVerifier) Verify(r *http.Request) (bool, error) {
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return false, nil
+	}
+	token := strings.TrimPrefix(authHeader, "Bearer ")
+
+	review := &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     token,
+			Audiences: v.Audiences,
+		},
+	}
+
+	start := time.Now()
+	result, err := v.Client.AuthenticationV1().TokenReviews().Create(r.Context(), review, metav1.CreateOptions{})
+	observeKubernetesAPICall("tokenreview", start)
+	if err != nil {
+		return false, fmt.Errorf("tokenreview request failed: %w", err)
+	}
+	if !result.Status.Authenticated {
+		return false, nil
+	}
+	return true, nil
+}
+
+// MTLSVerifier accepts requests presenting a client certificate whose CN or any SAN appears
+// in AllowedNames. The TLS handshake itself (and validation against the configured client CA
+// bundle) happens in net/http before the handler runs; this verifier only applies the
+// allowlist on top of an already-valid chain.
+type MTLSVerifier struct {
+	AllowedNames map[string]bool
+}
+
+func (v *MTLSVerifier) Name() string { return "mtls" }
+
+func (v *MTLSVerifier) Verify(r *http.Request) (bool, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return false, nil
+	}
+
+	if len(v.AllowedNames) == 0 {
+		return true, nil
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	if v.AllowedNames[cert.Subject.CommonName] {
+		return true, nil
+	}
+	for _, san := range cert.DNSNames {
+		if v.AllowedNames[san] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// namesToSet turns a comma-separated CN/SAN allowlist flag value into a lookup set. An empty
+// value yields an empty (not nil) set, which MTLSVerifier treats as "allow any verified cert".
+func namesToSet(value string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range splitCommaList(value) {
+		set[name] = true
+	}
+	return set
+}
+
+// buildVerifierChain turns the --auth-modes flag into a configured VerifierChain. Modes are
+// chained in the order given; "token" and "mtls" only need locally-supplied config, while
+// "tokenreview" additionally builds a Kubernetes clientset to call the API server.
+func buildVerifierChain(authModes, token, tokenReviewAudiences, allowedClientNames string) (VerifierChain, error) {
+	var chain VerifierChain
+	for _, mode := range splitCommaList(authModes) {
+		switch mode {
+		case "token":
+			chain = append(chain, &StaticTokenVerifier{Token: token})
+		case "tokenreview":
+			clientset, err := createClientset()
+			if err != nil {
+				return nil, fmt.Errorf("tokenreview auth mode: %w", err)
+			}
+			chain = append(chain, &TokenReviewVerifier{
+				Client:    clientset,
+				Audiences: splitCommaList(tokenReviewAudiences),
+			})
+		case "mtls":
+			chain = append(chain, &MTLSVerifier{AllowedNames: namesToSet(allowedClientNames)})
+		default:
+			return nil, fmt.Errorf("unknown auth mode %q", mode)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("at least one auth mode must be configured")
+	}
+	return chain, nil
+}
+
+// buildMTLSConfig loads the client CA bundle from caFile and returns a tls.Config that
+// requires and verifies a client certificate against it. MTLSVerifier then applies the
+// CN/SAN allowlist on top of the already-validated chain.
+func buildMTLSConfig(caFile string) (*tls.Config, error) {
+	pemBytes, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}, nil
+}
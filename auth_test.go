@@ -0,0 +1,298 @@
+// auth_test.go
+// Table-driven tests for the auth verifier chain: each verifier in isolation, plus the
+// chain's fail-closed semantics (a verifier erroring or rejecting must never be treated as an
+// implicit allow).
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStaticTokenVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		authHeader string
+		wantOK     bool
+	}{
+		{"matching token", "secret", "Bearer secret", true},
+		{"wrong token", "secret", "Bearer wrong", false},
+		{"missing header", "secret", "", false},
+		{"non-bearer scheme", "secret", "Basic secret", false},
+		{"empty configured token still requires exact match", "", "Bearer ", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &StaticTokenVerifier{Token: tt.token}
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/getparams.execute", nil)
+			if tt.authHeader != "" {
+				r.Header.Set("Authorization", tt.authHeader)
+			}
+			ok, err := v.Verify(r)
+			if err != nil {
+				t.Fatalf("Verify() returned unexpected error: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("Verify() = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMTLSVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowedNames map[string]bool
+		tlsState     *tls.ConnectionState
+		wantOK       bool
+	}{
+		{"no TLS on request", nil, nil, false},
+		{"no peer certificates", nil, &tls.ConnectionState{}, false},
+		{
+			name:         "empty allowlist accepts any verified cert",
+			allowedNames: map[string]bool{},
+			tlsState:     stateWithCert(pkix.Name{CommonName: "anything"}, nil),
+			wantOK:       true,
+		},
+		{
+			name:         "CN matches allowlist",
+			allowedNames: map[string]bool{"argocd": true},
+			tlsState:     stateWithCert(pkix.Name{CommonName: "argocd"}, nil),
+			wantOK:       true,
+		},
+		{
+			name:         "SAN matches allowlist",
+			allowedNames: map[string]bool{"argocd.svc": true},
+			tlsState:     stateWithCert(pkix.Name{CommonName: "other"}, []string{"argocd.svc"}),
+			wantOK:       true,
+		},
+		{
+			name:         "neither CN nor SAN matches",
+			allowedNames: map[string]bool{"argocd": true},
+			tlsState:     stateWithCert(pkix.Name{CommonName: "intruder"}, []string{"intruder.svc"}),
+			wantOK:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &MTLSVerifier{AllowedNames: tt.allowedNames}
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/getparams.execute", nil)
+			r.TLS = tt.tlsState
+			ok, err := v.Verify(r)
+			if err != nil {
+				t.Fatalf("Verify() returned unexpected error: %v", err)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("Verify() = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func stateWithCert(subject pkix.Name, sanDNSNames []string) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{
+			{Subject: subject, DNSNames: sanDNSNames},
+		},
+	}
+}
+
+func TestTokenReviewVerifier_Verify(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticated bool
+		reactorErr    error
+		wantOK        bool
+		wantErr       bool
+	}{
+		{"authenticated token", true, nil, true, false},
+		{"unauthenticated token", false, nil, false, false},
+		{"API server call fails", false, errors.New("connection refused"), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+			clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if tt.reactorErr != nil {
+					return true, nil, tt.reactorErr
+				}
+				return true, &authenticationv1.TokenReview{
+					Status: authenticationv1.TokenReviewStatus{Authenticated: tt.authenticated},
+				}, nil
+			})
+
+			v := &TokenReviewVerifier{Client: clientset}
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/getparams.execute", nil)
+			r.Header.Set("Authorization", "Bearer sometoken")
+
+			ok, err := v.Verify(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Errorf("Verify() = %v, want %v", ok, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestTokenReviewVerifier_Verify_NoBearerHeader(t *testing.T) {
+	v := &TokenReviewVerifier{Client: fake.NewSimpleClientset()}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/getparams.execute", nil)
+
+	ok, err := v.Verify(r)
+	if err != nil {
+		t.Fatalf("Verify() returned unexpected error: %v", err)
+	}
+	if ok {
+		t.Errorf("Verify() = true, want false for request without an Authorization header")
+	}
+}
+
+// stubVerifier is a fixed-outcome Verifier used to exercise VerifierChain in isolation from
+// any real auth scheme.
+type stubVerifier struct {
+	name string
+	ok   bool
+	err  error
+}
+
+func (s *stubVerifier) Name() string { return s.name }
+
+func (s *stubVerifier) Verify(r *http.Request) (bool, error) { return s.ok, s.err }
+
+func TestVerifierChain_Verify(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain VerifierChain
+		want  bool
+	}{
+		{
+			name:  "single verifier accepts",
+			chain: VerifierChain{&stubVerifier{name: "a", ok: true}},
+			want:  true,
+		},
+		{
+			name:  "single verifier rejects",
+			chain: VerifierChain{&stubVerifier{name: "a", ok: false}},
+			want:  false,
+		},
+		{
+			name: "first rejects, second accepts",
+			chain: VerifierChain{
+				&stubVerifier{name: "a", ok: false},
+				&stubVerifier{name: "b", ok: true},
+			},
+			want: true,
+		},
+		{
+			name: "all verifiers reject: fails closed",
+			chain: VerifierChain{
+				&stubVerifier{name: "a", ok: false},
+				&stubVerifier{name: "b", ok: false},
+			},
+			want: false,
+		},
+		{
+			name: "all verifiers error: fails closed, errors are not treated as allow",
+			chain: VerifierChain{
+				&stubVerifier{name: "a", err: errors.New("unreachable")},
+				&stubVerifier{name: "b", err: errors.New("unreachable")},
+			},
+			want: false,
+		},
+		{
+			name: "one verifier errors, another rejects: still fails closed",
+			chain: VerifierChain{
+				&stubVerifier{name: "a", err: errors.New("unreachable")},
+				&stubVerifier{name: "b", ok: false},
+			},
+			want: false,
+		},
+		{
+			name: "one verifier errors, another accepts: chain keeps trying",
+			chain: VerifierChain{
+				&stubVerifier{name: "a", err: errors.New("unreachable")},
+				&stubVerifier{name: "b", ok: true},
+			},
+			want: true,
+		},
+		{
+			name:  "empty chain fails closed",
+			chain: VerifierChain{},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/getparams.execute", nil)
+			if got := tt.chain.Verify(r); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildVerifierChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		authModes string
+		wantErr   bool
+		wantNames []string
+	}{
+		{"static token only", "token", false, []string{"static-token"}},
+		{"token and mtls chained in order", "token,mtls", false, []string{"static-token", "mtls"}},
+		{"unknown mode rejected", "token,bogus", true, nil},
+		{"empty mode list rejected", "", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := buildVerifierChain(tt.authModes, "tok", "", "")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("buildVerifierChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(chain) != len(tt.wantNames) {
+				t.Fatalf("buildVerifierChain() chain length = %d, want %d", len(chain), len(tt.wantNames))
+			}
+			for i, v := range chain {
+				if v.Name() != tt.wantNames[i] {
+					t.Errorf("chain[%d].Name() = %q, want %q", i, v.Name(), tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNamesToSet(t *testing.T) {
+	set := namesToSet("argocd, argocd.svc,,  ")
+	want := map[string]bool{"argocd": true, "argocd.svc": true}
+	if len(set) != len(want) {
+		t.Fatalf("namesToSet() = %v, want %v", set, want)
+	}
+	for name := range want {
+		if !set[name] {
+			t.Errorf("namesToSet() missing %q", name)
+		}
+	}
+}
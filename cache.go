@@ -0,0 +1,187 @@
+// cache.go
+// Informer-driven cache of Location CRDs, used to serve getparams.execute without a
+// per-request round trip to the Kubernetes API server.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LocationCache maintains an in-memory, informer-backed index of Location CRDs keyed by
+// "namespace/name". It is populated by one or more shared informer watches and never hits
+// the API server outside of the initial list and subsequent watch events.
+type LocationCache struct {
+	// informers holds one informer per watched namespace, or a single cluster-wide informer
+	// when namespaces is empty. Get/List fan out across all of them and merge the results.
+	informers []cache.SharedIndexInformer
+
+	mu     sync.RWMutex
+	synced bool
+}
+
+// NewLocationCache builds a LocationCache backed by dynamic shared informers over the
+// Location GVR. namespaces restricts the watch to those namespaces, one filtered informer
+// per entry; an empty slice watches cluster-wide with a single informer.
+func NewLocationCache(client dynamic.Interface, namespaces []string, resyncPeriod time.Duration) *LocationCache {
+	gvr := infrastructurev1alpha1.GroupVersion.WithResource("locations")
+
+	var informers []cache.SharedIndexInformer
+	if len(namespaces) == 0 {
+		factory := dynamicinformer.NewDynamicSharedInformerFactory(client, resyncPeriod)
+		informers = append(informers, factory.ForResource(gvr).Informer())
+	} else {
+		// NewFilteredDynamicSharedInformerFactory only accepts a single namespace, so fan out
+		// one informer per requested namespace; Get/List below merge them behind a single
+		// Location-store interface.
+		for _, ns := range namespaces {
+			factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, resyncPeriod, ns, nil)
+			informers = append(informers, factory.ForResource(gvr).Informer())
+		}
+	}
+
+	return &LocationCache{informers: informers}
+}
+
+// Start runs every informer until ctx is cancelled and blocks until all of their initial
+// lists have synced. It is safe to call Get/List concurrently with Start once it returns.
+func (lc *LocationCache) Start(ctx context.Context) error {
+	hasSynced := make([]cache.InformerSynced, 0, len(lc.informers))
+	for _, informer := range lc.informers {
+		informer := informer
+		go informer.Run(ctx.Done())
+		hasSynced = append(hasSynced, informer.HasSynced)
+	}
+
+	if !cache.WaitForCacheSync(ctx.Done(), hasSynced...) {
+		return fmt.Errorf("failed to sync Location informer cache")
+	}
+
+	lc.mu.Lock()
+	lc.synced = true
+	lc.mu.Unlock()
+	return nil
+}
+
+// HasSynced reports whether the informer has completed its initial list/watch handshake.
+// It is used by the /readyz handler.
+func (lc *LocationCache) HasSynced() bool {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.synced
+}
+
+// Get returns the Location stored for namespace/name along with its resourceVersion, which
+// callers use to populate the ETag response header. It checks every watched namespace's
+// informer store, since a key only ever lives in the store scoped to its own namespace.
+func (lc *LocationCache) Get(namespace, name string) (*infrastructurev1alpha1.Location, string, error) {
+	key := namespace + "/" + name
+	for _, informer := range lc.informers {
+		obj, exists, err := informer.GetStore().GetByKey(key)
+		if err != nil {
+			return nil, "", err
+		}
+		if !exists {
+			continue
+		}
+
+		location := &infrastructurev1alpha1.Location{}
+		resourceVersion, err := decodeLocation(obj, location)
+		if err != nil {
+			return nil, "", err
+		}
+		return location, resourceVersion, nil
+	}
+	return nil, "", fmt.Errorf("location %s not found", key)
+}
+
+// List returns every Location currently in the cache, optionally restricted to namespaces.
+// An empty namespaces slice returns all Locations.
+func (lc *LocationCache) List(namespaces []string) ([]*infrastructurev1alpha1.Location, error) {
+	return lc.ListSelected(namespaces, "", "")
+}
+
+// ListSelected returns Locations matching namespaces, labelSelector and fieldSelector. Any
+// of the three may be left empty/nil to skip that filter; fieldSelector is matched against
+// metadata.name and metadata.namespace, the only fields the dynamic client exposes here.
+func (lc *LocationCache) ListSelected(namespaces []string, labelSelector, fieldSelector string) ([]*infrastructurev1alpha1.Location, error) {
+	allowedNamespaces := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		allowedNamespaces[ns] = true
+	}
+
+	selector := labels.Everything()
+	if labelSelector != "" {
+		parsed, err := labels.Parse(labelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid labelSelector %q: %w", labelSelector, err)
+		}
+		selector = parsed
+	}
+
+	fieldSel := fields.Everything()
+	if fieldSelector != "" {
+		parsed, err := fields.ParseSelector(fieldSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fieldSelector %q: %w", fieldSelector, err)
+		}
+		fieldSel = parsed
+	}
+
+	var out []*infrastructurev1alpha1.Location
+	for _, informer := range lc.informers {
+		for _, obj := range informer.GetStore().List() {
+			u, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			if len(allowedNamespaces) > 0 && !allowedNamespaces[u.GetNamespace()] {
+				continue
+			}
+			if !selector.Matches(labels.Set(u.GetLabels())) {
+				continue
+			}
+			fieldSet := fields.Set{"metadata.name": u.GetName(), "metadata.namespace": u.GetNamespace()}
+			if !fieldSel.Matches(fieldSet) {
+				continue
+			}
+
+			location := &infrastructurev1alpha1.Location{}
+			if _, err := decodeLocation(obj, location); err != nil {
+				return nil, err
+			}
+			out = append(out, location)
+		}
+	}
+	return out, nil
+}
+
+// decodeLocation converts an informer store entry into a typed Location, returning its
+// resourceVersion alongside it.
+func decodeLocation(obj interface{}, location *infrastructurev1alpha1.Location) (string, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return "", fmt.Errorf("unexpected object type %T in Location cache", obj)
+	}
+
+	temp, err := json.Marshal(u.Object)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(temp, location); err != nil {
+		return "", err
+	}
+	return u.GetResourceVersion(), nil
+}
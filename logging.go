@@ -0,0 +1,44 @@
+// logging.go
+// Structured, leveled logging for the plugin, replacing the ad-hoc log.Printf calls used
+// during its early development.
+
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger is the process-wide structured logger. It's replaced in main() once --log-level
+// and --log-format are parsed; the text-format default below only covers code paths that run
+// before that (there are none today, but it keeps logger safe to use unconditionally).
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// newLogger builds a slog.Logger writing to stderr at the given level ("debug", "info",
+// "warn" or "error") in either "text" or "json" format.
+func newLogger(level, format string) *slog.Logger {
+	var handler slog.Handler
+	opts := &slog.HandlerOptions{Level: parseLogLevel(level)}
+
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	return slog.New(handler)
+}
+
+// parseLogLevel maps a --log-level value to a slog.Level, defaulting to info for anything
+// unrecognized.
+func parseLogLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -5,21 +5,26 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	kruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -35,6 +40,25 @@ type RequestPayload struct {
 type ParameterTypes struct {
 	Name      string `json:"name"`
 	Namespace string `json:"namespace"`
+
+	// LabelSelector, FieldSelector and Namespaces select multiple Locations at once,
+	// mirroring Argo's List/Cluster generators. When Name is empty and any of them is set,
+	// the handler switches to list mode and returns one parameter entry per matched
+	// NodeGroup instead of a single object's parameters; when Name is set they are ignored.
+	LabelSelector string   `json:"labelSelector"`
+	FieldSelector string   `json:"fieldSelector"`
+	Namespaces    []string `json:"namespaces"`
+}
+
+// isEmpty reports whether no selection criteria were provided at all.
+func (p ParameterTypes) isEmpty() bool {
+	return p.Name == "" && p.Namespace == "" && p.LabelSelector == "" && p.FieldSelector == "" && len(p.Namespaces) == 0
+}
+
+// isListMode reports whether the request selects multiple Locations via selector/namespace
+// list rather than a single Name.
+func (p ParameterTypes) isListMode() bool {
+	return p.Name == "" && (p.LabelSelector != "" || p.FieldSelector != "" || len(p.Namespaces) > 0)
 }
 
 // getEnvOrDefault returns the value of an environment variable or a default value
@@ -55,22 +79,40 @@ func getEnvBoolOrDefault(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvDurationOrDefault returns the duration value of an environment variable or a default value
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// buildRestConfig resolves a Kubernetes client config, preferring in-cluster config (when
+// running in a pod) and falling back to the local kubeconfig file.
+func buildRestConfig() (*rest.Config, error) {
+	if config, err := rest.InClusterConfig(); err == nil {
+		return config, nil
+	}
+
+	kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes config: %v", err)
+	}
+	return config, nil
+}
+
 // createKubernetesClient creates a Kubernetes dynamic client
 func createKubernetesClient() (dynamic.Interface, error) {
 	scheme := kruntime.NewScheme()
 	clientsetscheme.AddToScheme(scheme)
 	infrastructurev1alpha1.AddToScheme(scheme)
 
-	var config *rest.Config
-	var err error
-
-	// Try in-cluster config first (when running in a pod)
-	if config, err = rest.InClusterConfig(); err != nil {
-		// Fall back to kubeconfig file
-		kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
-		if config, err = clientcmd.BuildConfigFromFlags("", kubeconfig); err != nil {
-			return nil, fmt.Errorf("failed to create Kubernetes config: %v", err)
-		}
+	config, err := buildRestConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	client, err := dynamic.NewForConfig(config)
@@ -81,125 +123,354 @@ func createKubernetesClient() (dynamic.Interface, error) {
 	return client, nil
 }
 
-// getLocation reads a single Location CRD from Kubernetes
-func getLocation(client dynamic.Interface, namespace string, name string, location *infrastructurev1alpha1.Location) error {
-	ctx := context.Background()
-	unstructuredObj, err := client.Resource(infrastructurev1alpha1.GroupVersion.WithResource("locations")).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+// createClientset creates a typed Kubernetes clientset, used by the TokenReview verifier.
+func createClientset() (kubernetes.Interface, error) {
+	config, err := buildRestConfig()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	temp, err := json.Marshal(unstructuredObj.Object)
+
+	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to create Kubernetes clientset: %v", err)
 	}
-	err = json.Unmarshal(temp, &location)
-	return err
+	return clientset, nil
+}
+
+// splitCommaList splits a comma-separated flag/env value into a slice, dropping empty and
+// whitespace-only entries. An empty input yields a nil slice.
+func splitCommaList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getNamespaceList splits a comma-separated namespace flag/env value into a slice, meaning
+// "all namespaces" when empty.
+func getNamespaceList(value string) []string {
+	return splitCommaList(value)
+}
+
+// usesMTLS reports whether authModes enables the mtls verifier, used to validate that its
+// required TLS flags are also set before the server starts.
+func usesMTLS(authModes string) bool {
+	for _, mode := range splitCommaList(authModes) {
+		if mode == "mtls" {
+			return true
+		}
+	}
+	return false
+}
+
+// handleListMode serves the selector/namespace-list request shape: it matches zero or more
+// Locations and returns one flattened parameter entry per NodeGroup, mirroring Argo's
+// List/Cluster generators.
+func handleListMode(w http.ResponseWriter, reqLogger *slog.Logger, locationCache *LocationCache, transformer *Transformer, inputParams ParameterTypes) {
+	reqLogger.Debug("received list request", "namespaces", inputParams.Namespaces, "labelSelector", inputParams.LabelSelector, "fieldSelector", inputParams.FieldSelector)
+
+	if locationCache == nil {
+		requestsTotal.WithLabelValues("unavailable").Inc()
+		http.Error(w, "location cache not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	locations, err := locationCache.ListSelected(inputParams.Namespaces, inputParams.LabelSelector, inputParams.FieldSelector)
+	if err != nil {
+		reqLogger.Warn("failed to list locations", "error", err)
+		requestsTotal.WithLabelValues("bad_request").Inc()
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	parameters := []map[string]interface{}{}
+	for _, location := range locations {
+		count := 0
+		for _, ng := range location.Spec.NodeGroups {
+			param, err := transformer.Transform(TransformInput{Location: location, CacheConfig: ng.CacheConfig})
+			if err != nil {
+				reqLogger.Warn("failed to transform CacheConfigSpec", "namespace", location.Namespace, "name", location.Name, "error", err)
+				requestsTotal.WithLabelValues("internal_error").Inc()
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			param["location"] = location.Name
+			param["namespace"] = location.Namespace
+			parameters = append(parameters, param)
+			count++
+		}
+		resultCardinality.WithLabelValues("list").Observe(float64(count))
+	}
+
+	output := map[string]interface{}{
+		"output": map[string]interface{}{
+			"parameters": parameters,
+		},
+	}
+
+	reqLogger.Debug("response output", "output", output)
+
+	requestsTotal.WithLabelValues("ok").Inc()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(output)
 }
 
 func main() {
 	// Define command-line flags with defaults from environment variables
 	var (
-		port    = flag.String("port", getEnvOrDefault("PORT", "8080"), "Port to run the server on (env: PORT)")
-		token   = flag.String("token", getEnvOrDefault("TOKEN", "randtoken"), "Argo token (env: TOKEN)")
-		verbose = flag.Bool("verbose", getEnvBoolOrDefault("VERBOSE", false), "Enable verbose logging (env: VERBOSE)")
+		port                 = flag.String("port", getEnvOrDefault("PORT", "8080"), "Port to run the server on (env: PORT)")
+		metricsPort          = flag.String("metrics-port", getEnvOrDefault("METRICS_PORT", "8081"), "Port to serve /metrics and /readyz on; always plain HTTP so kubelet probes and Prometheus scrapes succeed even when --auth-modes=mtls requires a client cert on --port (env: METRICS_PORT)")
+		token                = flag.String("token", getEnvOrDefault("TOKEN", "randtoken"), "Argo token, used by the static-token auth mode (env: TOKEN)")
+		verbose              = flag.Bool("verbose", getEnvBoolOrDefault("VERBOSE", false), "Shorthand for --log-level=debug (env: VERBOSE)")
+		logLevel             = flag.String("log-level", getEnvOrDefault("LOG_LEVEL", "info"), "Log level: debug, info, warn, error (env: LOG_LEVEL)")
+		logFormat            = flag.String("log-format", getEnvOrDefault("LOG_FORMAT", "text"), "Log output format: text or json (env: LOG_FORMAT)")
+		namespaces           = flag.String("namespaces", getEnvOrDefault("NAMESPACES", ""), "Comma-separated list of namespaces to watch for Locations, empty for cluster-wide (env: NAMESPACES)")
+		resyncPeriod         = flag.Duration("resync-period", getEnvDurationOrDefault("RESYNC_PERIOD", 10*time.Minute), "Informer resync period (env: RESYNC_PERIOD)")
+		authModes            = flag.String("auth-modes", getEnvOrDefault("AUTH_MODES", "token"), "Comma-separated auth verifiers to enable, chained in order: token, tokenreview, mtls (env: AUTH_MODES)")
+		tokenReviewAudiences = flag.String("tokenreview-audiences", getEnvOrDefault("TOKENREVIEW_AUDIENCES", ""), "Comma-separated expected audiences for the tokenreview auth mode (env: TOKENREVIEW_AUDIENCES)")
+		clientCAFile         = flag.String("client-ca-file", getEnvOrDefault("CLIENT_CA_FILE", ""), "PEM bundle of CAs trusted to sign client certificates, required for the mtls auth mode (env: CLIENT_CA_FILE)")
+		tlsCertFile          = flag.String("tls-cert-file", getEnvOrDefault("TLS_CERT_FILE", ""), "Server TLS certificate, required for the mtls auth mode (env: TLS_CERT_FILE)")
+		tlsKeyFile           = flag.String("tls-key-file", getEnvOrDefault("TLS_KEY_FILE", ""), "Server TLS private key, required for the mtls auth mode (env: TLS_KEY_FILE)")
+		allowedClientNames   = flag.String("allowed-client-names", getEnvOrDefault("ALLOWED_CLIENT_NAMES", ""), "Comma-separated CN/SAN allowlist for mtls client certs, empty allows any cert signed by client-ca-file (env: ALLOWED_CLIENT_NAMES)")
+		transformTemplate    = flag.String("transform-template", getEnvOrDefault("TRANSFORM_TEMPLATE", ""), "Path to a Go text/template (with sprig helpers) rendered per CacheConfigSpec to build the returned parameter map, empty reproduces the raw spec (env: TRANSFORM_TEMPLATE)")
+		dryRun               = flag.String("dry-run", "", "Path to a sample Location YAML file; if set, render --transform-template against it and print the parameters to stdout instead of starting the server")
 	)
 	flag.Parse()
 
 	if *verbose {
-		log.Println("Verbose logging enabled")
-		log.Printf("Server configuration: port=%s, token=%s", *port, *token)
-		log.Printf("Environment variables: PORT=%s, TOKEN=%s, VERBOSE=%s", os.Getenv("PORT"), os.Getenv("TOKEN"), os.Getenv("VERBOSE"))
+		*logLevel = "debug"
 	}
+	logger = newLogger(*logLevel, *logFormat)
+
+	logger.Debug("server configuration", "port", *port, "metricsPort", *metricsPort, "namespaces", *namespaces, "resyncPeriod", *resyncPeriod, "authModes", *authModes, "logLevel", *logLevel, "logFormat", *logFormat)
+
+	transformer, err := LoadTransformer(*transformTemplate)
+	if err != nil {
+		logger.Error("failed to load transform template", "error", err)
+		os.Exit(1)
+	}
+
+	if *dryRun != "" {
+		if err := runDryRun(*dryRun, transformer); err != nil {
+			logger.Error("dry run failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Create Kubernetes client
 	k8sClient, err := createKubernetesClient()
 	if err != nil {
-		log.Printf("Warning: Failed to create Kubernetes client: %v", err)
-		log.Println("Locations CRD data will not be available")
-	} else if *verbose {
-		log.Println("Kubernetes client created successfully")
+		logger.Warn("failed to create Kubernetes client, Locations CRD data will not be available", "error", err)
+	} else {
+		logger.Debug("Kubernetes client created successfully")
+	}
+
+	verifiers, err := buildVerifierChain(*authModes, *token, *tokenReviewAudiences, *allowedClientNames)
+	if err != nil {
+		logger.Error("failed to configure auth", "error", err)
+		os.Exit(1)
+	}
+	logger.Info("auth verifiers enabled", "modes", *authModes)
+
+	if usesMTLS(*authModes) && (*clientCAFile == "" || *tlsCertFile == "" || *tlsKeyFile == "") {
+		logger.Error("mtls auth mode requires --client-ca-file, --tls-cert-file and --tls-key-file; the server never terminates TLS without them, so every request would be rejected")
+		os.Exit(1)
 	}
 
+	var tlsConfig *tls.Config
+	if *clientCAFile != "" {
+		tlsConfig, err = buildMTLSConfig(*clientCAFile)
+		if err != nil {
+			logger.Error("failed to configure mTLS", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	var locationCache *LocationCache
+	if k8sClient != nil {
+		locationCache = NewLocationCache(k8sClient, getNamespaceList(*namespaces), *resyncPeriod)
+		if err := locationCache.Start(ctx); err != nil {
+			logger.Warn("failed to start Location informer cache", "error", err)
+			locationCache = nil
+		} else {
+			logger.Debug("Location informer cache synced")
+		}
+	}
+
+	// /metrics and /readyz are served on their own plain-HTTP listener, separate from the
+	// (possibly mTLS) API port: TLS client-cert verification happens at the handshake, before
+	// routing, so kubelet's probes and Prometheus's scrape would otherwise fail the handshake
+	// whenever --auth-modes=mtls is enabled.
+	metricsMux := http.NewServeMux()
+
+	metricsMux.Handle("/metrics", promhttp.Handler())
+
+	metricsMux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if locationCache == nil || !locationCache.HasSynced() {
+			http.Error(w, "location informer not synced", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	})
+
+	metricsServer := &http.Server{
+		Addr:    fmt.Sprintf(":%s", *metricsPort),
+		Handler: metricsMux,
+	}
+
+	go func() {
+		logger.Info("metrics server running", "addr", metricsServer.Addr)
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("metrics server exited", "error", err)
+		}
+	}()
+
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/v1/getparams.execute", func(w http.ResponseWriter, r *http.Request) {
+		reqLogger := logger.With("method", r.Method, "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+
 		// Check method
 		if r.Method != http.MethodPost {
+			reqLogger.Warn("rejected request", "decision", "method_not_allowed")
+			requestsTotal.WithLabelValues("method_not_allowed").Inc()
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Check Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if !strings.HasPrefix(authHeader, "Bearer ") || strings.TrimPrefix(authHeader, "Bearer ") != *token {
-			if *verbose {
-				log.Printf("Authorization failed for request to %s", r.URL.Path)
-			}
+		// Check the request against the configured auth verifier chain
+		if !verifiers.Verify(r) {
+			reqLogger.Warn("rejected request", "decision", "forbidden")
+			requestsTotal.WithLabelValues("forbidden").Inc()
 			http.Error(w, "forbidden", http.StatusForbidden)
 			return
 		}
 
-		if *verbose {
-			log.Printf("Authorized request to %s", r.URL.Path)
-		}
+		reqLogger.Debug("authorized request", "decision", "authorized")
 
 		// Read request body
 		bodyBytes, err := io.ReadAll(r.Body)
 		if err != nil {
+			requestsTotal.WithLabelValues("bad_request").Inc()
 			http.Error(w, "bad request", http.StatusBadRequest)
 			return
 		}
 
 		reqData := &RequestPayload{}
 		if err := json.Unmarshal(bodyBytes, reqData); err != nil {
+			unmarshalErrorsTotal.Inc()
+			requestsTotal.WithLabelValues("bad_request").Inc()
 			http.Error(w, "bad request", http.StatusBadRequest)
 			return
 		}
 
 		inputParams := reqData.Input.Parameters
-		if inputParams == (ParameterTypes{}) {
+		if inputParams.isEmpty() {
+			requestsTotal.WithLabelValues("bad_request").Inc()
 			http.Error(w, "missing input.parameters", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("Received request for Location: namespace=%s, name=%s", inputParams.Namespace, inputParams.Name)
+		if inputParams.isListMode() {
+			handleListMode(w, reqLogger, locationCache, transformer, inputParams)
+			return
+		}
+
+		reqLogger.Debug("received request for Location", "namespace", inputParams.Namespace, "name", inputParams.Name)
 
-		// Get Locations from Kubernetes if client is available
+		// Get the Location from the informer cache if available
 		location := &infrastructurev1alpha1.Location{}
-		if k8sClient != nil {
+		var resourceVersion string
+		if locationCache != nil {
 			var err error
-			err = getLocation(k8sClient, inputParams.Namespace, inputParams.Name, location)
+			location, resourceVersion, err = locationCache.Get(inputParams.Namespace, inputParams.Name)
 			if err != nil {
-				log.Printf("Warning: Failed to get Location: %v", err)
-			} else if *verbose {
-				log.Printf("Successfully retrieved Location: %s", location.Name)
+				reqLogger.Warn("failed to get Location from cache", "namespace", inputParams.Namespace, "name", inputParams.Name, "error", err)
+				cacheResultsTotal.WithLabelValues("miss").Inc()
+				location = &infrastructurev1alpha1.Location{}
+			} else {
+				reqLogger.Debug("retrieved Location from cache", "name", location.Name)
+				cacheResultsTotal.WithLabelValues("hit").Inc()
 			}
 		}
 
-		cacheConfigSpecs := []infrastructurev1alpha1.CacheConfigSpec{}
+		if resourceVersion != "" {
+			etag := fmt.Sprintf("%q", resourceVersion)
+			if match := r.Header.Get("If-None-Match"); match == etag {
+				requestsTotal.WithLabelValues("not_modified").Inc()
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			// resourceVersion is an opaque string, not a timestamp, so it belongs in ETag only;
+			// Last-Modified requires an actual HTTP-date and we have no reliable one to offer.
+			w.Header().Set("ETag", etag)
+		}
 
+		parameters := []map[string]interface{}{}
 		for _, ng := range location.Spec.NodeGroups {
-			cacheConfigSpecs = append(cacheConfigSpecs, ng.CacheConfig)
+			param, err := transformer.Transform(TransformInput{Location: location, CacheConfig: ng.CacheConfig})
+			if err != nil {
+				reqLogger.Warn("failed to transform CacheConfigSpec", "namespace", location.Namespace, "name", location.Name, "error", err)
+				requestsTotal.WithLabelValues("internal_error").Inc()
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			parameters = append(parameters, param)
 		}
+		resultCardinality.WithLabelValues("single").Observe(float64(len(parameters)))
 
 		output := map[string]interface{}{
 			"output": map[string]interface{}{
-				"parameters": cacheConfigSpecs,
+				"parameters": parameters,
 			},
 		}
 
-		if *verbose {
-			log.Printf("Response output: %+v", output)
-		}
+		reqLogger.Debug("response output", "output", output)
 
+		requestsTotal.WithLabelValues("ok").Inc()
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(output)
 	})
 
-	serverAddr := fmt.Sprintf(":%s", *port)
-	log.Printf("Server running on %s", serverAddr)
-	if *verbose {
-		log.Printf("API endpoint available at /api/v1/getparams.execute")
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%s", *port),
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down server gracefully")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.Error("error during server shutdown", "error", err)
+		}
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("error during metrics server shutdown", "error", err)
+		}
+	}()
+
+	logger.Info("server running", "addr", server.Addr)
+	logger.Debug("API endpoint available", "path", "/api/v1/getparams.execute")
+
+	var listenErr error
+	if tlsConfig != nil {
+		listenErr = server.ListenAndServeTLS(*tlsCertFile, *tlsKeyFile)
+	} else {
+		listenErr = server.ListenAndServe()
+	}
+	if listenErr != nil && listenErr != http.ErrServerClosed {
+		logger.Error("server exited", "error", listenErr)
+		os.Exit(1)
 	}
-	log.Fatal(http.ListenAndServe(serverAddr, mux))
 }
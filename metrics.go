@@ -0,0 +1,65 @@
+// metrics.go
+// Prometheus instrumentation for the getparams.execute handler, exposed on /metrics.
+
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// requestsTotal counts getparams.execute requests by outcome (ok, bad_request,
+	// forbidden, method_not_allowed, unavailable, not_modified, internal_error).
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "argocd_locations_plugin_requests_total",
+		Help: "Total getparams.execute requests, by outcome.",
+	}, []string{"outcome"})
+
+	// authFailuresTotal counts requests rejected by an individual auth verifier.
+	authFailuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "argocd_locations_plugin_auth_failures_total",
+		Help: "Total requests rejected by an individual auth verifier, by verifier.",
+	}, []string{"verifier"})
+
+	// unmarshalErrorsTotal counts request bodies that failed to decode as JSON.
+	unmarshalErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "argocd_locations_plugin_unmarshal_errors_total",
+		Help: "Total request bodies that failed to decode as JSON.",
+	})
+
+	// kubernetesAPIDuration observes the latency of calls that hit the Kubernetes API
+	// server directly, rather than being served from the Location informer cache.
+	kubernetesAPIDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "argocd_locations_plugin_kubernetes_api_duration_seconds",
+		Help:    "Latency of direct Kubernetes API calls, by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	// cacheResultsTotal counts Location lookups served from the informer cache, by
+	// hit/miss.
+	cacheResultsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "argocd_locations_plugin_cache_results_total",
+		Help: "Total Location cache lookups, by result.",
+	}, []string{"result"})
+
+	// resultCardinality observes how many parameter entries a request returned, by request
+	// mode ("single" for a Name lookup, "list" per matched Location in selector/namespace-list
+	// mode). It is deliberately not labeled by Location name: Prometheus client_golang never
+	// evicts label combinations, and Locations are created/renamed/deleted over the process
+	// lifetime, so a per-Location label would grow without bound. The cache hit/miss metric
+	// carries no Location label either; per-Location detail is available only from logs.
+	resultCardinality = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "argocd_locations_plugin_result_cardinality",
+		Help:    "Number of parameter entries returned per request, by request mode.",
+		Buckets: []float64{0, 1, 2, 4, 8, 16, 32, 64, 128},
+	}, []string{"mode"})
+)
+
+// observeKubernetesAPICall records the duration of a direct Kubernetes API call under
+// operation (e.g. "tokenreview").
+func observeKubernetesAPICall(operation string, start time.Time) {
+	kubernetesAPIDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,123 @@
+// transform.go
+// Optional Go-template based projection of CacheConfigSpec (and its parent Location) into
+// the parameter map returned to Argo, so operators can derive fields (e.g. a hostname built
+// from the Location's region) without changing the CRD.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	infrastructurev1alpha1 "github.com/EdgeCDN-X/edgecdnx-controller/api/v1alpha1"
+	"github.com/Masterminds/sprig/v3"
+	"sigs.k8s.io/yaml"
+)
+
+// TransformInput is the data made available to --transform-template: the CacheConfigSpec
+// being projected and the Location it belongs to, for cross-referencing fields like region.
+type TransformInput struct {
+	Location    *infrastructurev1alpha1.Location
+	CacheConfig infrastructurev1alpha1.CacheConfigSpec
+}
+
+// defaultTransformTemplate reproduces today's behavior: the CacheConfigSpec, verbatim, as
+// the parameter map.
+const defaultTransformTemplate = `{{ .CacheConfig | toJson }}`
+
+// Transformer renders a TransformInput into the parameter map returned to Argo.
+type Transformer struct {
+	tmpl *template.Template
+}
+
+// NewTransformer parses templateText with sprig helpers plus a toJson helper for embedding a
+// Go value as its JSON representation. An empty templateText parses defaultTransformTemplate.
+func NewTransformer(templateText string) (*Transformer, error) {
+	if templateText == "" {
+		templateText = defaultTransformTemplate
+	}
+
+	tmpl, err := template.New("transform").
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(template.FuncMap{"toJson": toJSON}).
+		Parse(templateText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse transform template: %w", err)
+	}
+	return &Transformer{tmpl: tmpl}, nil
+}
+
+// LoadTransformer builds a Transformer from the template file at path, or the default
+// template when path is empty.
+func LoadTransformer(path string) (*Transformer, error) {
+	if path == "" {
+		return NewTransformer("")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transform template %s: %w", path, err)
+	}
+	return NewTransformer(string(data))
+}
+
+// Transform renders input against the template and unmarshals the result as a parameter map.
+// The template is expected to produce a JSON object.
+func (t *Transformer) Transform(input TransformInput) (map[string]interface{}, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, input); err != nil {
+		return nil, fmt.Errorf("failed to execute transform template: %w", err)
+	}
+
+	params := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &params); err != nil {
+		return nil, fmt.Errorf("transform template output is not valid JSON: %w", err)
+	}
+	return params, nil
+}
+
+// toJSON is the "toJson" template helper: it marshals v and returns it as a string so it can
+// be embedded directly in a template that otherwise builds a JSON object by hand.
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// runDryRun loads a sample Location from a YAML file, renders the transform template against
+// each of its NodeGroups' CacheConfigSpecs, and prints the resulting parameters as JSON to
+// stdout. It's meant for local debugging of a --transform-template without a cluster.
+func runDryRun(samplePath string, transformer *Transformer) error {
+	yamlBytes, err := os.ReadFile(samplePath)
+	if err != nil {
+		return fmt.Errorf("failed to read dry-run sample %s: %w", samplePath, err)
+	}
+
+	jsonBytes, err := yaml.YAMLToJSON(yamlBytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse dry-run sample as YAML: %w", err)
+	}
+
+	location := &infrastructurev1alpha1.Location{}
+	if err := json.Unmarshal(jsonBytes, location); err != nil {
+		return fmt.Errorf("failed to unmarshal dry-run sample into a Location: %w", err)
+	}
+
+	parameters := []map[string]interface{}{}
+	for _, ng := range location.Spec.NodeGroups {
+		out, err := transformer.Transform(TransformInput{Location: location, CacheConfig: ng.CacheConfig})
+		if err != nil {
+			return err
+		}
+		parameters = append(parameters, out)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(parameters)
+}